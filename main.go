@@ -8,15 +8,16 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
 	"github.com/disiqueira/gotree"
 	"github.com/fatih/color"
-	"github.com/olivere/elastic"
 	"github.com/pkg/errors"
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/module/apmhttp"
@@ -28,6 +29,14 @@ var (
 	kibanaURL     *url.URL
 	traceID       string
 	pollDuration  time.Duration
+	minPoll       time.Duration
+	maxPoll       time.Duration
+	exportFile    string
+	importFile    string
+	viewMode      string
+	backend       string
+	backendURL    string
+	otlpEndpoint  string
 )
 
 func init() {
@@ -35,6 +44,14 @@ func init() {
 	flag.StringVar(&kibanaURLFlag, "kibana", "http://localhost:5601", "Base URL for Kibana")
 	flag.StringVar(&traceID, "trace", "", "Trace ID to query (must not also specify URL to fetch)")
 	flag.DurationVar(&pollDuration, "d", 30*time.Second, "Amount of time to wait for events")
+	flag.DurationVar(&minPoll, "min-poll", 500*time.Millisecond, "Minimum interval between polls for new trace events")
+	flag.DurationVar(&maxPoll, "max-poll", 8*time.Second, "Maximum interval between polls for new trace events")
+	flag.StringVar(&exportFile, "export", "", "Write the fetched trace to this file as a portable trace bundle")
+	flag.StringVar(&importFile, "import", "", "Render a trace bundle previously written with -export, without querying Elasticsearch")
+	flag.StringVar(&viewMode, "view", "tree", "Rendering mode: tree or waterfall")
+	flag.StringVar(&backend, "backend", "es", "Trace store backend: es, jaeger or zipkin")
+	flag.StringVar(&backendURL, "backend-url", "", "Base URL for the jaeger or zipkin backend (defaults to http://localhost:16686 for jaeger, http://localhost:9411 for zipkin); ignored for es, which always uses -es")
+	flag.StringVar(&otlpEndpoint, "otlp", "", "OTLP/HTTP collector endpoint (e.g. http://localhost:4318) to re-emit the assembled trace to")
 
 	flag.Usage = usage
 }
@@ -50,7 +67,7 @@ func main() {
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) != 1 && traceID == "" {
+	if importFile == "" && len(args) != 1 && traceID == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -61,9 +78,20 @@ func main() {
 		log.Fatalf("failed to parse Kibana URL %q: %v", kibanaURLFlag, err)
 	}
 
-	var deadline time.Time
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		fmt.Fprintln(os.Stderr, "\ninterrupted, rendering trace so far...")
+		cancel()
+		<-sigCh
+		os.Exit(1)
+	}()
+
 	var recentRequest bool
-	if len(args) == 1 {
+	if importFile == "" && len(args) == 1 {
 		if traceID != "" {
 			flag.Usage()
 		}
@@ -74,32 +102,76 @@ func main() {
 		doRequest(url)
 		recentRequest = true
 		fmt.Printf("polling for new events for %s...\n\n", pollDuration)
-		deadline = time.Now().Add(pollDuration)
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithTimeout(ctx, pollDuration)
+		defer cancelDeadline()
 	}
 
+	store := newTraceStore()
+
+	var nodes map[nodeId]nodeDetails
 	var lastNodeCount int
+	var stop bool
+	backoff := minPoll
 queryNodes:
 	for {
-		var nodes map[nodeId]nodeDetails
 		for {
-			if recentRequest {
-				if !time.Now().Before(deadline) {
-					return
-				}
-				time.Sleep(5 * time.Second)
-			}
+			var fetched map[nodeId]nodeDetails
 			var err error
-			nodes, err = fetchTrace(context.Background())
+			if importFile != "" {
+				fetched, err = loadTrace(importFile)
+			} else {
+				fetched, err = store.FetchTrace(ctx, traceID)
+			}
 			if err != nil {
+				if ctx.Err() != nil {
+					stop = true
+					break
+				}
 				log.Fatal(err)
 			}
+			nodes = fetched
 			if len(nodes) != lastNodeCount {
 				lastNodeCount = len(nodes)
+				backoff = minPoll
+				break
+			}
+			if !recentRequest {
+				break
+			}
+			select {
+			case <-time.After(jitter(backoff)):
+			case <-ctx.Done():
+				stop = true
+			}
+			if stop {
+				break
+			}
+			if backoff *= 2; backoff > maxPoll {
+				backoff = maxPoll
+			}
+		}
+
+		if nodes == nil {
+			// Cancelled or timed out before a single successful fetch.
+			return
+		}
+
+		if exportFile != "" {
+			if err := saveTrace(exportFile, nodes); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if traceID == "" {
+			for id := range nodes {
+				traceID = id.traceID
 				break
 			}
 		}
 
 		var rootTransactions []nodeId
+		var orphanedIDs []nodeId
 		root := gotree.New("")
 		orphaned := gotree.New(color.RedString("<orphaned>"))
 		treeNodes := make(map[nodeId]gotree.Tree)
@@ -117,32 +189,60 @@ queryNodes:
 		for id, node := range nodes {
 			parentNode := treeNodes[nodeId{traceID: id.traceID, spanID: node.parentID}]
 			if parentNode == nil {
-				if recentRequest {
+				if recentRequest && !stop {
 					// Missing a node, so go back and query again.
 					continue queryNodes
 				}
 				parentNode = orphaned
+				orphanedIDs = append(orphanedIDs, id)
 			}
 			parentNode.AddTree(treeNodes[id])
 			if node.transaction && parentNode == root {
 				rootTransactions = append(rootTransactions, id)
 			}
 		}
-		for _, id := range rootTransactions {
-			fmt.Println(treeNodes[id].Print())
-			if transactionURL, err := transactionURL(id, nodes[id]); err == nil {
-				fmt.Printf("✨ Open in Kibana: %s ✨\n\n", color.YellowString(transactionURL))
+		switch viewMode {
+		case "waterfall":
+			renderWaterfall(nodes, rootTransactions, orphanedIDs)
+		default:
+			for _, id := range rootTransactions {
+				fmt.Println(treeNodes[id].Print())
+				if transactionURL, err := transactionURL(id, nodes[id]); err == nil {
+					fmt.Printf("✨ Open in Kibana: %s ✨\n\n", color.YellowString(transactionURL))
+				}
+			}
+			if len(orphaned.Items()) > 0 {
+				fmt.Println(orphaned.Print())
 			}
 		}
-		if len(orphaned.Items()) > 0 {
-			fmt.Println(orphaned.Print())
-		}
-		if !recentRequest {
+		if !recentRequest || stop {
+			if otlpEndpoint != "" {
+				// Only the final, fully-assembled trace is forwarded, so the
+				// collector doesn't see the same spans re-sent on every poll.
+				// ctx may already be cancelled (deadline reached, SIGINT) by
+				// the time we get here, so export on a fresh context.
+				exportCtx, cancelExport := context.WithTimeout(context.Background(), 10*time.Second)
+				err := exportOTLP(exportCtx, otlpEndpoint, nodes)
+				cancelExport()
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
 			break
 		}
 	}
 }
 
+// jitter returns a randomized duration in [d/2, d], so that concurrent
+// invocations of this tool polling the same Elasticsearch cluster don't
+// all land on the same cadence.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
 func doRequest(url *url.URL) {
 	client := apmhttp.WrapClient(http.DefaultClient)
 	tx := apm.DefaultTracer.StartTransaction("GET "+url.String(), "request")
@@ -220,102 +320,15 @@ type nodeDetails struct {
 	parentID    string
 	name        string
 	type_       string
+	subtype     string
 	service     string
 	result      string
 	transaction bool
+	timestamp   time.Time
+	duration    time.Duration
 }
 
 type nodeId struct {
 	traceID string
 	spanID  string
 }
-
-func fetchTrace(ctx context.Context) (map[nodeId]nodeDetails, error) {
-	esClient := newElasticsearchClient()
-	msearchResult, err := esClient.MultiSearch().Add(
-		elastic.NewSearchRequest().
-			Index("apm-*-transaction-*").
-			SearchSource(elastic.NewSearchSource().
-				Size(10000).
-				Query(elastic.NewTermQuery("trace.id", traceID))),
-
-		elastic.NewSearchRequest().
-			Index("apm-*-span-*").
-			SearchSource(elastic.NewSearchSource().
-				Size(10000).
-				Query(elastic.NewTermQuery("trace.id", traceID))),
-	).Do(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "querying elasticsearch")
-	}
-
-	type source struct {
-		Context struct {
-			Service struct {
-				Name string
-			}
-		}
-		Trace  struct{ ID string } `json:"trace"`
-		Parent struct{ ID string } `json:"parent"`
-		Span   *struct {
-			HexID string `json:"hex_id"`
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-		}
-		Transaction *struct {
-			ID     string
-			Name   string `json:"name"`
-			Type   string `json:"type"`
-			Result string `json:"result"`
-		}
-	}
-
-	nodes := make(map[nodeId]nodeDetails)
-	for _, response := range msearchResult.Responses {
-		if response.Error != nil {
-			return nil, errors.Errorf("%s", response.Error.Reason)
-		}
-		hits := response.Hits
-		if hits.TotalHits > int64(len(hits.Hits)) {
-			// TODO(axw) could use scroll instead
-			return nil, errors.Errorf("too many hits")
-		}
-		for _, hit := range hits.Hits {
-			var source source
-			if err := json.Unmarshal(*hit.Source, &source); err != nil {
-				return nil, errors.Wrap(err, "failed to unmarshal _source")
-			}
-
-			var nodeId nodeId
-			var nodeDetails nodeDetails
-			switch {
-			case source.Span != nil:
-				nodeId.spanID = source.Span.HexID
-				nodeDetails.name = source.Span.Name
-				nodeDetails.type_ = source.Span.Type
-			case source.Transaction != nil:
-				nodeId.spanID = source.Transaction.ID
-				nodeDetails.name = source.Transaction.Name
-				nodeDetails.type_ = source.Transaction.Type
-				nodeDetails.result = source.Transaction.Result
-				nodeDetails.transaction = true
-			default:
-				panic("no transaction or span in doc")
-			}
-			nodeId.traceID = source.Trace.ID
-			nodeDetails.parentID = source.Parent.ID
-			nodeDetails.service = source.Context.Service.Name
-			nodes[nodeId] = nodeDetails
-		}
-	}
-	return nodes, nil
-}
-
-func newElasticsearchClient() *elastic.Client {
-	urls := strings.Fields(esURL)
-	client, err := elastic.NewClient(elastic.SetURL(urls...))
-	if err != nil {
-		log.Fatal("failed to create client", err)
-	}
-	return client
-}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// exportOTLP converts nodes into OpenTelemetry spans and posts them to
+// endpoint over OTLP/HTTP, so a captured APM trace can be forwarded into a
+// Tempo/Jaeger/OTel Collector pipeline.
+func exportOTLP(ctx context.Context, endpoint string, nodes map[nodeId]nodeDetails) error {
+	traces := nodesToTraces(nodes)
+
+	body, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(traces)
+	if err != nil {
+		return errors.Wrap(err, "marshaling OTLP traces")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "sending OTLP traces")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("otlp collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// nodesToTraces converts nodes -- as assembled by a TraceStore, with start
+// and end timestamps from the waterfall view's timestamp/duration fields
+// -- into an OpenTelemetry ptrace.Traces, with one ResourceSpans per
+// service.name.
+func nodesToTraces(nodes map[nodeId]nodeDetails) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	scopeSpansByService := make(map[string]ptrace.ScopeSpans)
+
+	for id, node := range nodes {
+		scopeSpans, ok := scopeSpansByService[node.service]
+		if !ok {
+			rs := traces.ResourceSpans().AppendEmpty()
+			rs.Resource().Attributes().PutStr("service.name", node.service)
+			scopeSpans = rs.ScopeSpans().AppendEmpty()
+			scopeSpansByService[node.service] = scopeSpans
+		}
+
+		span := scopeSpans.Spans().AppendEmpty()
+		span.SetTraceID(toTraceID(id.traceID))
+		span.SetSpanID(toSpanID(id.spanID))
+		if node.parentID != "" {
+			span.SetParentSpanID(toSpanID(node.parentID))
+		}
+		span.SetName(node.name)
+		if node.transaction {
+			span.SetKind(ptrace.SpanKindServer)
+		} else {
+			span.SetKind(ptrace.SpanKindInternal)
+		}
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(node.timestamp))
+		span.SetEndTimestamp(pcommon.NewTimestampFromTime(node.timestamp.Add(node.duration)))
+		span.Attributes().PutStr("span.type", node.type_)
+		if node.subtype != "" {
+			span.Attributes().PutStr("span.subtype", node.subtype)
+		}
+		if node.result != "" {
+			span.Attributes().PutStr("transaction.result", node.result)
+		}
+	}
+	return traces
+}
+
+// toTraceID decodes a hex-encoded APM trace ID into the 16-byte array
+// OpenTelemetry requires, truncating or left-padding with zeroes as
+// necessary.
+func toTraceID(s string) pcommon.TraceID {
+	var id pcommon.TraceID
+	b, _ := hex.DecodeString(s)
+	if len(b) > len(id) {
+		b = b[len(b)-len(id):]
+	}
+	copy(id[len(id)-len(b):], b)
+	return id
+}
+
+// toSpanID decodes a hex-encoded APM span ID into the 8-byte array
+// OpenTelemetry requires, truncating or left-padding with zeroes as
+// necessary.
+func toSpanID(s string) pcommon.SpanID {
+	var id pcommon.SpanID
+	b, _ := hex.DecodeString(s)
+	if len(b) > len(id) {
+		b = b[len(b)-len(id):]
+	}
+	copy(id[len(id)-len(b):], b)
+	return id
+}
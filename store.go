@@ -0,0 +1,29 @@
+package main
+
+import "context"
+
+// TraceStore fetches all transactions and spans for a trace ID and decodes
+// them into the map[nodeId]nodeDetails shape the tree and waterfall
+// renderers expect, regardless of which backend the data came from.
+type TraceStore interface {
+	FetchTrace(ctx context.Context, traceID string) (map[nodeId]nodeDetails, error)
+}
+
+// newTraceStore constructs the TraceStore selected by the -backend flag.
+func newTraceStore() TraceStore {
+	switch backend {
+	case "jaeger":
+		return &jaegerStore{baseURL: backendURLOrDefault("http://localhost:16686")}
+	case "zipkin":
+		return &zipkinStore{baseURL: backendURLOrDefault("http://localhost:9411")}
+	default:
+		return &elasticsearchStore{}
+	}
+}
+
+func backendURLOrDefault(def string) string {
+	if backendURL != "" {
+		return backendURL
+	}
+	return def
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+)
+
+// elasticsearchStore is the TraceStore backed by an Elastic APM deployment.
+// It is the original and default backend.
+type elasticsearchStore struct{}
+
+func (elasticsearchStore) FetchTrace(ctx context.Context, traceID string) (map[nodeId]nodeDetails, error) {
+	esClient := newElasticsearchClient()
+
+	nodes := make(map[nodeId]nodeDetails)
+	for _, index := range []string{"apm-*-transaction-*", "apm-*-span-*"} {
+		if err := scrollNodes(ctx, esClient, index, traceID, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// scrollNodes fetches every transaction or span document matching traceID
+// in index, using an Elasticsearch scroll so that traces with more than a
+// single page of hits are fully rendered rather than bailing out.
+func scrollNodes(ctx context.Context, esClient *elastic.Client, index, traceID string, nodes map[nodeId]nodeDetails) error {
+	scroll := esClient.Scroll(index).
+		Query(elastic.NewTermQuery("trace.id", traceID)).
+		Sort("@timestamp", true).
+		Size(1000).
+		Scroll("1m")
+	defer scroll.Clear(ctx)
+
+	for {
+		result, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "querying elasticsearch")
+		}
+		for _, hit := range result.Hits.Hits {
+			id, details, err := decodeNode(hit)
+			if err != nil {
+				return err
+			}
+			nodes[id] = details
+		}
+	}
+}
+
+func decodeNode(hit *elastic.SearchHit) (nodeId, nodeDetails, error) {
+	type duration struct {
+		Us int64 `json:"us"`
+	}
+
+	type source struct {
+		Timestamp string `json:"@timestamp"`
+		Context   struct {
+			Service struct {
+				Name string
+			}
+		}
+		Trace  struct{ ID string } `json:"trace"`
+		Parent struct{ ID string } `json:"parent"`
+		Span   *struct {
+			HexID    string   `json:"hex_id"`
+			Name     string   `json:"name"`
+			Type     string   `json:"type"`
+			Subtype  string   `json:"subtype"`
+			Duration duration `json:"duration"`
+		}
+		Transaction *struct {
+			ID       string
+			Name     string   `json:"name"`
+			Type     string   `json:"type"`
+			Result   string   `json:"result"`
+			Duration duration `json:"duration"`
+		}
+	}
+
+	var src source
+	if err := json.Unmarshal(*hit.Source, &src); err != nil {
+		return nodeId{}, nodeDetails{}, errors.Wrap(err, "failed to unmarshal _source")
+	}
+
+	var nodeId nodeId
+	var nodeDetails nodeDetails
+	switch {
+	case src.Span != nil:
+		nodeId.spanID = src.Span.HexID
+		nodeDetails.name = src.Span.Name
+		nodeDetails.type_ = src.Span.Type
+		nodeDetails.subtype = src.Span.Subtype
+		nodeDetails.duration = time.Duration(src.Span.Duration.Us) * time.Microsecond
+	case src.Transaction != nil:
+		nodeId.spanID = src.Transaction.ID
+		nodeDetails.name = src.Transaction.Name
+		nodeDetails.type_ = src.Transaction.Type
+		nodeDetails.result = src.Transaction.Result
+		nodeDetails.transaction = true
+		nodeDetails.duration = time.Duration(src.Transaction.Duration.Us) * time.Microsecond
+	default:
+		panic("no transaction or span in doc")
+	}
+	nodeId.traceID = src.Trace.ID
+	nodeDetails.parentID = src.Parent.ID
+	nodeDetails.service = src.Context.Service.Name
+	if ts, err := time.Parse(time.RFC3339Nano, src.Timestamp); err == nil {
+		nodeDetails.timestamp = ts
+	}
+	return nodeId, nodeDetails, nil
+}
+
+func newElasticsearchClient() *elastic.Client {
+	urls := strings.Fields(esURL)
+	client, err := elastic.NewClient(elastic.SetURL(urls...))
+	if err != nil {
+		log.Fatal("failed to create client", err)
+	}
+	return client
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// jaegerStore is the TraceStore backed by a Jaeger query service, fetched
+// over its HTTP JSON API at /api/traces/{traceID}.
+type jaegerStore struct {
+	baseURL string
+}
+
+func (s *jaegerStore) FetchTrace(ctx context.Context, traceID string) (map[nodeId]nodeDetails, error) {
+	req, err := http.NewRequest("GET", s.baseURL+"/api/traces/"+traceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "querying jaeger")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("jaeger returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			TraceID string `json:"traceID"`
+			Spans   []struct {
+				TraceID       string `json:"traceID"`
+				SpanID        string `json:"spanID"`
+				ProcessID     string `json:"processID"`
+				OperationName string `json:"operationName"`
+				StartTime     int64  `json:"startTime"` // microseconds since epoch
+				Duration      int64  `json:"duration"`  // microseconds
+				References    []struct {
+					RefType string `json:"refType"`
+					TraceID string `json:"traceID"`
+					SpanID  string `json:"spanID"`
+				} `json:"references"`
+			} `json:"spans"`
+			Processes map[string]struct {
+				ServiceName string `json:"serviceName"`
+			} `json:"processes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decoding jaeger response")
+	}
+
+	nodes := make(map[nodeId]nodeDetails)
+	for _, trace := range result.Data {
+		for _, span := range trace.Spans {
+			var parentID string
+			for _, ref := range span.References {
+				if ref.RefType == "CHILD_OF" {
+					parentID = ref.SpanID
+					break
+				}
+			}
+			nodes[nodeId{traceID: span.TraceID, spanID: span.SpanID}] = nodeDetails{
+				parentID:    parentID,
+				name:        span.OperationName,
+				type_:       "span",
+				service:     trace.Processes[span.ProcessID].ServiceName,
+				transaction: parentID == "",
+				timestamp:   time.Unix(0, span.StartTime*int64(time.Microsecond)),
+				duration:    time.Duration(span.Duration) * time.Microsecond,
+			}
+		}
+	}
+	return nodes, nil
+}
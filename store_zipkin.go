@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// zipkinStore is the TraceStore backed by a Zipkin server, fetched over
+// its v2 HTTP API at /api/v2/trace/{traceID}. Shared client/server spans
+// (same id, "shared" sampling) are disambiguated by kind; see FetchTrace.
+type zipkinStore struct {
+	baseURL string
+}
+
+func (s *zipkinStore) FetchTrace(ctx context.Context, traceID string) (map[nodeId]nodeDetails, error) {
+	req, err := http.NewRequest("GET", s.baseURL+"/api/v2/trace/"+traceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "querying zipkin")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("zipkin returned status %d", resp.StatusCode)
+	}
+
+	var spans []struct {
+		TraceID       string `json:"traceId"`
+		ID            string `json:"id"`
+		ParentID      string `json:"parentId"`
+		Name          string `json:"name"`
+		Kind          string `json:"kind"`
+		Timestamp     int64  `json:"timestamp"` // microseconds since epoch
+		Duration      int64  `json:"duration"`  // microseconds
+		LocalEndpoint struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"localEndpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spans); err != nil {
+		return nil, errors.Wrap(err, "decoding zipkin response")
+	}
+
+	nodes := make(map[nodeId]nodeDetails)
+	for _, span := range spans {
+		id := nodeId{traceID: span.TraceID, spanID: span.ID}
+		details := nodeDetails{
+			parentID:    span.ParentID,
+			name:        span.Name,
+			type_:       span.Kind,
+			service:     span.LocalEndpoint.ServiceName,
+			transaction: span.ParentID == "",
+			timestamp:   time.Unix(0, span.Timestamp*int64(time.Microsecond)),
+			duration:    time.Duration(span.Duration) * time.Microsecond,
+		}
+		if _, exists := nodes[id]; exists {
+			// Zipkin v2 allows a client and server span to share the same
+			// id ("shared" sampling). Rather than letting the second one
+			// silently overwrite the first, disambiguate it by kind and
+			// nest it under the span it shares an id with. A later span
+			// with the same id and the same (possibly empty) kind as an
+			// already disambiguated one overwrites it -- Zipkin doesn't
+			// give us anything else to key on.
+			id.spanID += "-" + strings.ToLower(span.Kind)
+			details.parentID = span.ID
+		}
+		nodes[id] = details
+	}
+	return nodes, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// traceRecord is the on-disk representation of a single trace node
+// (transaction or span). nodeId and nodeDetails both have unexported
+// fields, so they cannot be (de)serialized directly; traceRecord mirrors
+// them with exported, JSON-tagged fields instead.
+type traceRecord struct {
+	TraceID     string        `json:"trace_id"`
+	SpanID      string        `json:"span_id"`
+	ParentID    string        `json:"parent_id"`
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Subtype     string        `json:"subtype,omitempty"`
+	Service     string        `json:"service"`
+	Result      string        `json:"result,omitempty"`
+	Transaction bool          `json:"transaction,omitempty"`
+	Timestamp   time.Time     `json:"timestamp,omitempty"`
+	Duration    time.Duration `json:"duration_ns,omitempty"`
+}
+
+// saveTrace writes nodes to path as a newline-delimited JSON trace bundle,
+// one record per transaction or span. The bundle can later be read back
+// with loadTrace and rendered without a live Elasticsearch connection.
+func saveTrace(path string, nodes map[nodeId]nodeDetails) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating trace bundle")
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for id, node := range nodes {
+		record := traceRecord{
+			TraceID:     id.traceID,
+			SpanID:      id.spanID,
+			ParentID:    node.parentID,
+			Name:        node.name,
+			Type:        node.type_,
+			Subtype:     node.subtype,
+			Service:     node.service,
+			Result:      node.result,
+			Transaction: node.transaction,
+			Timestamp:   node.timestamp,
+			Duration:    node.duration,
+		}
+		if err := enc.Encode(record); err != nil {
+			return errors.Wrap(err, "writing trace bundle")
+		}
+	}
+	return nil
+}
+
+// loadTrace is the offline counterpart to TraceStore.FetchTrace: it reads a trace
+// bundle previously written by saveTrace and reconstructs the
+// map[nodeId]nodeDetails that the tree renderer expects.
+func loadTrace(path string) (map[nodeId]nodeDetails, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening trace bundle")
+	}
+	defer f.Close()
+
+	nodes := make(map[nodeId]nodeDetails)
+	dec := json.NewDecoder(f)
+	for {
+		var record traceRecord
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "reading trace bundle")
+		}
+		id := nodeId{traceID: record.TraceID, spanID: record.SpanID}
+		nodes[id] = nodeDetails{
+			parentID:    record.ParentID,
+			name:        record.Name,
+			type_:       record.Type,
+			subtype:     record.Subtype,
+			service:     record.Service,
+			result:      record.Result,
+			transaction: record.Transaction,
+			timestamp:   record.Timestamp,
+			duration:    record.Duration,
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadTraceRoundTrip(t *testing.T) {
+	want := map[nodeId]nodeDetails{
+		{traceID: "trace1", spanID: "root"}: {
+			name:        "GET /",
+			type_:       "request",
+			service:     "frontend",
+			transaction: true,
+			timestamp:   time.Date(2026, 7, 27, 12, 0, 0, 0, time.UTC),
+			duration:    100 * time.Millisecond,
+		},
+		{traceID: "trace1", spanID: "child"}: {
+			parentID:  "root",
+			name:      "SELECT users",
+			type_:     "db",
+			subtype:   "postgresql",
+			service:   "frontend",
+			result:    "success",
+			timestamp: time.Date(2026, 7, 27, 12, 0, 0, 10*int(time.Millisecond), time.UTC),
+			duration:  20 * time.Millisecond,
+		},
+	}
+
+	f, err := os.CreateTemp("", "trace-bundle-*.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	if err := saveTrace(path, want); err != nil {
+		t.Fatalf("saveTrace: %v", err)
+	}
+
+	got, err := loadTrace(path)
+	if err != nil {
+		t.Fatalf("loadTrace: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d nodes, want %d", len(got), len(want))
+	}
+	for id, wantNode := range want {
+		gotNode, ok := got[id]
+		if !ok {
+			t.Fatalf("missing node %+v after round trip", id)
+		}
+		if !gotNode.timestamp.Equal(wantNode.timestamp) {
+			t.Errorf("node %+v: timestamp = %v, want %v", id, gotNode.timestamp, wantNode.timestamp)
+		}
+		gotNode.timestamp = wantNode.timestamp
+		if gotNode != wantNode {
+			t.Errorf("node %+v = %+v, want %+v", id, gotNode, wantNode)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const waterfallWidth = 80
+
+// renderWaterfall prints an ASCII timeline per root transaction, sorted by
+// start time, with bars scaled to the root transaction's duration. The
+// critical path under each root -- the longest chain of child spans,
+// chosen by the child whose latest descendant end time is maximal -- is
+// highlighted in bold red. Nodes whose parent is missing from the trace,
+// along with their descendants, are rendered separately, as the tree
+// view's "<orphaned>" section does.
+func renderWaterfall(nodes map[nodeId]nodeDetails, rootTransactions, orphaned []nodeId) {
+	children := make(map[nodeId][]nodeId)
+	for id, node := range nodes {
+		parent := nodeId{traceID: id.traceID, spanID: node.parentID}
+		children[parent] = append(children[parent], id)
+	}
+
+	roots := append([]nodeId(nil), rootTransactions...)
+	sort.Slice(roots, func(i, j int) bool {
+		return nodes[roots[i]].timestamp.Before(nodes[roots[j]].timestamp)
+	})
+
+	for _, rootID := range roots {
+		root := nodes[rootID]
+		fmt.Printf("%s (%s) - %s\n", root.name, root.service, root.duration)
+
+		critical := criticalPath(nodes, children, rootID)
+		rows := subtreeRows(nodes, children, rootID)
+
+		for _, id := range rows {
+			node := nodes[id]
+			offset := node.timestamp.Sub(root.timestamp)
+			bar := waterfallBar(offset, node.duration, root.duration)
+			line := fmt.Sprintf("%-40s %s", waterfallLabel(node), bar)
+			if critical[id] {
+				line = color.New(color.FgRed, color.Bold).Sprint(line)
+			}
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
+
+	if len(orphaned) > 0 {
+		renderOrphanedWaterfall(nodes, children, orphaned)
+	}
+}
+
+// subtreeRows returns id and all of its descendants, depth-first, with
+// children at each level sorted by start time -- the same order used to
+// print a waterfall.
+func subtreeRows(nodes map[nodeId]nodeDetails, children map[nodeId][]nodeId, id nodeId) []nodeId {
+	var rows []nodeId
+	var walk func(id nodeId)
+	walk = func(id nodeId) {
+		rows = append(rows, id)
+		childIDs := append([]nodeId(nil), children[id]...)
+		sort.Slice(childIDs, func(i, j int) bool {
+			return nodes[childIDs[i]].timestamp.Before(nodes[childIDs[j]].timestamp)
+		})
+		for _, child := range childIDs {
+			walk(child)
+		}
+	}
+	walk(id)
+	return rows
+}
+
+// renderOrphanedWaterfall prints a timeline for nodes with no parent in the
+// trace and all of their descendants, scaled against the earliest start
+// and latest end across the whole orphan group since there is no root
+// transaction to scale against.
+func renderOrphanedWaterfall(nodes map[nodeId]nodeDetails, children map[nodeId][]nodeId, orphaned []nodeId) {
+	tops := append([]nodeId(nil), orphaned...)
+	sort.Slice(tops, func(i, j int) bool {
+		return nodes[tops[i]].timestamp.Before(nodes[tops[j]].timestamp)
+	})
+
+	var rows []nodeId
+	for _, id := range tops {
+		rows = append(rows, subtreeRows(nodes, children, id)...)
+	}
+
+	earliest := nodes[rows[0]].timestamp
+	for _, id := range rows {
+		if ts := nodes[id].timestamp; ts.Before(earliest) {
+			earliest = ts
+		}
+	}
+	var total time.Duration
+	for _, id := range rows {
+		node := nodes[id]
+		if end := node.timestamp.Add(node.duration).Sub(earliest); end > total {
+			total = end
+		}
+	}
+
+	fmt.Println(color.RedString("<orphaned>"))
+	for _, id := range rows {
+		node := nodes[id]
+		offset := node.timestamp.Sub(earliest)
+		bar := waterfallBar(offset, node.duration, total)
+		fmt.Printf("%-40s %s\n", waterfallLabel(node), bar)
+	}
+	fmt.Println()
+}
+
+func waterfallLabel(node nodeDetails) string {
+	if node.subtype != "" {
+		return fmt.Sprintf("%s (%s/%s)", node.name, node.type_, node.subtype)
+	}
+	return fmt.Sprintf("%s (%s)", node.name, node.type_)
+}
+
+// waterfallBar renders a single ASCII timeline bar: offset and duration are
+// scaled against total to fit within waterfallWidth columns.
+func waterfallBar(offset, duration, total time.Duration) string {
+	if total <= 0 {
+		total = 1
+	}
+	start := int(offset * waterfallWidth / total)
+	length := int(duration * waterfallWidth / total)
+	if start < 0 {
+		start = 0
+	}
+	if start > waterfallWidth {
+		start = waterfallWidth
+	}
+	if length < 1 {
+		length = 1
+	}
+	if start+length > waterfallWidth {
+		length = waterfallWidth - start
+	}
+	return strings.Repeat(" ", start) + strings.Repeat("█", length)
+}
+
+// criticalPath computes, bottom-up, each node's latest reachable descendant
+// end time (its own end, or a descendant's if that finishes later), then
+// walks down from rootID following the child with the latest such end at
+// each step. This is what makes it the longest chain rather than a greedy
+// pick of the child whose own span ends latest.
+func criticalPath(nodes map[nodeId]nodeDetails, children map[nodeId][]nodeId, rootID nodeId) map[nodeId]bool {
+	maxEnd := make(map[nodeId]time.Time)
+	var compute func(id nodeId) time.Time
+	compute = func(id nodeId) time.Time {
+		if end, ok := maxEnd[id]; ok {
+			return end
+		}
+		end := nodes[id].timestamp.Add(nodes[id].duration)
+		for _, child := range children[id] {
+			if childEnd := compute(child); childEnd.After(end) {
+				end = childEnd
+			}
+		}
+		maxEnd[id] = end
+		return end
+	}
+	compute(rootID)
+
+	path := make(map[nodeId]bool)
+	id := rootID
+	for {
+		path[id] = true
+		var next nodeId
+		var found bool
+		for _, child := range children[id] {
+			if !found || maxEnd[child].After(maxEnd[next]) {
+				next, found = child, true
+			}
+		}
+		if !found {
+			return path
+		}
+		id = next
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCriticalPathPrefersDeeperDescendant(t *testing.T) {
+	start := time.Date(2026, 7, 27, 12, 0, 0, 0, time.UTC)
+	root := nodeId{traceID: "t", spanID: "root"}
+	a := nodeId{traceID: "t", spanID: "a"}
+	b := nodeId{traceID: "t", spanID: "b"}
+	b1 := nodeId{traceID: "t", spanID: "b1"}
+
+	nodes := map[nodeId]nodeDetails{
+		root: {timestamp: start, duration: 12 * time.Millisecond},
+		// a ends at 6ms: the greedy (own-end) choice, but not the longest chain.
+		a: {parentID: "root", timestamp: start, duration: 6 * time.Millisecond},
+		b: {parentID: "root", timestamp: start, duration: 4 * time.Millisecond},
+		// b1 ends at 11.5ms, later than a, so the critical path must go root->b->b1.
+		b1: {parentID: "b", timestamp: start.Add(4 * time.Millisecond), duration: 7500 * time.Microsecond},
+	}
+	children := map[nodeId][]nodeId{
+		root: {a, b},
+		b:    {b1},
+	}
+
+	got := criticalPath(nodes, children, root)
+	want := map[nodeId]bool{root: true, b: true, b1: true}
+	if len(got) != len(want) {
+		t.Fatalf("criticalPath = %v, want %v", got, want)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("criticalPath missing %+v", id)
+		}
+	}
+	if got[a] {
+		t.Errorf("criticalPath should not include %+v", a)
+	}
+}
+
+func TestSubtreeRowsWalksOrphanDescendants(t *testing.T) {
+	start := time.Date(2026, 7, 27, 12, 0, 0, 0, time.UTC)
+	orphan := nodeId{traceID: "t", spanID: "orphan"}
+	child := nodeId{traceID: "t", spanID: "child"}
+	grandchild := nodeId{traceID: "t", spanID: "grandchild"}
+
+	nodes := map[nodeId]nodeDetails{
+		// orphan's parentID does not match any node in the trace.
+		orphan:     {parentID: "missing", timestamp: start, duration: 10 * time.Millisecond},
+		child:      {parentID: "orphan", timestamp: start.Add(time.Millisecond), duration: 5 * time.Millisecond},
+		grandchild: {parentID: "child", timestamp: start.Add(2 * time.Millisecond), duration: time.Millisecond},
+	}
+	children := map[nodeId][]nodeId{
+		orphan: {child},
+		child:  {grandchild},
+	}
+
+	rows := subtreeRows(nodes, children, orphan)
+	want := []nodeId{orphan, child, grandchild}
+	if len(rows) != len(want) {
+		t.Fatalf("subtreeRows = %v, want %v", rows, want)
+	}
+	for i, id := range want {
+		if rows[i] != id {
+			t.Errorf("subtreeRows[%d] = %+v, want %+v", i, rows[i], id)
+		}
+	}
+}